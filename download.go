@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v25/github"
+)
+
+// stdoutMu serializes -json output from concurrent downloadAsset calls.
+var stdoutMu sync.Mutex
+
+// assetResult describes a downloaded asset for -json output.
+type assetResult struct {
+	Tag         string `json:"tag"`
+	ReleaseID   int64  `json:"release_id"`
+	AssetID     int64  `json:"asset_id"`
+	AssetName   string `json:"asset_name"`
+	Size        int    `json:"size"`
+	ContentType string `json:"content_type"`
+	SHA256      string `json:"sha256,omitempty"`
+	DownloadURL string `json:"download_url"`
+	PublishedAt string `json:"published_at"`
+	Path        string `json:"path"`
+}
+
+// downloadAsset downloads a single release asset to the current directory,
+// skipping it if a file with the same name already exists. The asset is
+// fetched into a resumable cache file first, optionally verified, then
+// renamed into place.
+func downloadAsset(ctx context.Context, client *github.Client, release *github.RepositoryRelease, args runArgs, asset github.ReleaseAsset) (err error) {
+	name := asset.GetName()
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("%s: %w", name, err)
+		}
+	}()
+	dst := filepath.Base(filepath.FromSlash(name))
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "skipping %q: file already exists\n", dst)
+		return nil
+	}
+	cachePath, err := fetchToCache(ctx, client, args, asset)
+	if err != nil {
+		return err
+	}
+	var sum hash.Hash
+	if args.Verify || args.JSON {
+		if sum, err = sha256File(cachePath); err != nil {
+			return err
+		}
+	}
+	if args.Verify {
+		if err := verifyAsset(ctx, client, release, args, name, sum.Sum(nil), cachePath); err != nil {
+			removeAssetCache(cachePath)
+			return err
+		}
+	}
+	if err := os.Rename(cachePath, dst); err != nil {
+		return err
+	}
+	if args.JSON {
+		return printAssetResult(release, asset, sum, dst)
+	}
+	return nil
+}
+
+// sha256File returns a hash.Hash holding the sha256 sum of the file at path.
+func sha256File(path string) (hash.Hash, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// printAssetResult writes a JSON object describing the downloaded asset to
+// stdout.
+func printAssetResult(release *github.RepositoryRelease, asset github.ReleaseAsset, sum hash.Hash, dst string) error {
+	res := assetResult{
+		Tag:         release.GetTagName(),
+		ReleaseID:   release.GetID(),
+		AssetID:     asset.GetID(),
+		AssetName:   asset.GetName(),
+		Size:        asset.GetSize(),
+		ContentType: asset.GetContentType(),
+		DownloadURL: asset.GetBrowserDownloadURL(),
+		PublishedAt: release.GetPublishedAt().Format(time.RFC3339),
+		Path:        dst,
+	}
+	if sum != nil {
+		res.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	}
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	return json.NewEncoder(os.Stdout).Encode(res)
+}
+
+// assetCacheMeta records the validators of a previously fetched asset, used
+// to resume its download via If-Range.
+type assetCacheMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// assetCacheDir returns (creating it if necessary) the directory used to
+// stage in-progress asset downloads across invocations.
+func assetCacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, "github-release-get")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// assetCachePaths returns the stable data and metadata file paths used to
+// cache asset id's in-progress download.
+func assetCachePaths(dir string, id int64) (data, meta string) {
+	data = filepath.Join(dir, fmt.Sprintf("%d", id))
+	return data, data + ".json"
+}
+
+func readAssetCacheMeta(path string) assetCacheMeta {
+	var m assetCacheMeta
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return m
+	}
+	json.Unmarshal(data, &m) // a corrupt or missing sidecar just forces a fresh download
+	return m
+}
+
+func writeAssetCacheMeta(path string, m assetCacheMeta) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// fetchToCache downloads asset into a stable cache file derived from its id
+// inside os.UserCacheDir, resuming a previous partial download via HTTP
+// Range and If-Range when possible, and returns the path to the complete
+// file. The caller is responsible for renaming or removing it.
+func fetchToCache(ctx context.Context, client *github.Client, args runArgs, asset github.ReleaseAsset) (string, error) {
+	dir, err := assetCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dataPath, metaPath := assetCachePaths(dir, asset.GetID())
+	rc, u, err := client.Repositories.DownloadReleaseAsset(ctx, args.Owner, args.Repo, asset.GetID())
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case rc != nil:
+		// The API token-authenticated download path doesn't support Range
+		// requests, so this always restarts from scratch.
+		defer rc.Close()
+		if err := writeFileFrom(dataPath, rc, false); err != nil {
+			return "", err
+		}
+	case u != "":
+		if err := fetchRangeToCache(ctx, u, dataPath, metaPath); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("cannot download asset, don't have sensible link for that")
+	}
+	if err := checkAssetSize(dataPath, asset); err != nil {
+		removeAssetCache(dataPath)
+		return "", err
+	}
+	return dataPath, nil
+}
+
+// removeAssetCache deletes the cache file at dataPath and its .json sidecar,
+// best effort, so a corrupted or truncated download doesn't get mistaken for
+// a complete one on the next run.
+func removeAssetCache(dataPath string) {
+	os.Remove(dataPath)
+	os.Remove(dataPath + ".json")
+}
+
+func fetchRangeToCache(ctx context.Context, u, dataPath, metaPath string) error {
+	meta := readAssetCacheMeta(metaPath)
+	var offset int64
+	if fi, err := os.Stat(dataPath); err == nil && (meta.ETag != "" || meta.LastModified != "") {
+		offset = fi.Size()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		switch {
+		case meta.ETag != "":
+			req.Header.Set("If-Range", meta.ETag)
+		case meta.LastModified != "":
+			req.Header.Set("If-Range", meta.LastModified)
+		}
+	}
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	switch r.StatusCode {
+	case http.StatusPartialContent, http.StatusOK, http.StatusRequestedRangeNotSatisfiable:
+	default:
+		return fmt.Errorf("invalid status: %s", r.Status)
+	}
+	// Store the validators before the body, so that a run interrupted while
+	// copying it can be resumed by the next one.
+	if err := writeAssetCacheMeta(metaPath, assetCacheMeta{
+		ETag:         r.Header.Get("ETag"),
+		LastModified: r.Header.Get("Last-Modified"),
+	}); err != nil {
+		return err
+	}
+	if r.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// Offset already covers the whole file; nothing to do.
+		return nil
+	}
+	return writeFileFrom(dataPath, r.Body, r.StatusCode == http.StatusPartialContent)
+}
+
+// writeFileFrom writes r to path, appending if appendTo is true and
+// truncating otherwise.
+func writeFileFrom(path string, r io.Reader, appendTo bool) error {
+	flags := os.O_WRONLY | os.O_CREATE
+	if appendTo {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// checkAssetSize fails loudly if the file at path doesn't match asset's
+// recorded size.
+func checkAssetSize(path string, asset github.ReleaseAsset) error {
+	want := int64(asset.GetSize())
+	if want <= 0 {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Size() != want {
+		return fmt.Errorf("size mismatch for %q: want %d, got %d", asset.GetName(), want, fi.Size())
+	}
+	return nil
+}
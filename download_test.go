@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v25/github"
+)
+
+func TestPrintAssetResult(t *testing.T) {
+	release := &github.RepositoryRelease{
+		ID:          github.Int64(42),
+		TagName:     github.String("v1.2.3"),
+		PublishedAt: &github.Timestamp{Time: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	asset := github.ReleaseAsset{
+		ID:                 github.Int64(7),
+		Name:               github.String("app_linux_amd64.tar.gz"),
+		Size:               github.Int(1234),
+		ContentType:        github.String("application/gzip"),
+		BrowserDownloadURL: github.String("https://example.invalid/app_linux_amd64.tar.gz"),
+	}
+	sum := sha256.New()
+	sum.Write([]byte("hello"))
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdout := os.Stdout
+	os.Stdout = w
+	resultCh := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Scan()
+		resultCh <- scanner.Text()
+	}()
+
+	err = printAssetResult(release, asset, sum, "app_linux_amd64.tar.gz")
+	w.Close()
+	os.Stdout = oldStdout
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := <-resultCh
+
+	var got assetResult
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatalf("printAssetResult: invalid JSON output %q: %v", line, err)
+	}
+	want := assetResult{
+		Tag:         "v1.2.3",
+		ReleaseID:   42,
+		AssetID:     7,
+		AssetName:   "app_linux_amd64.tar.gz",
+		Size:        1234,
+		ContentType: "application/gzip",
+		SHA256:      "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		DownloadURL: "https://example.invalid/app_linux_amd64.tar.gz",
+		PublishedAt: "2024-03-01T00:00:00Z",
+		Path:        "app_linux_amd64.tar.gz",
+	}
+	if got != want {
+		t.Errorf("printAssetResult output = %+v, want %+v", got, want)
+	}
+}
+
+func TestFetchRangeToCache(t *testing.T) {
+	cases := []struct {
+		name         string
+		existing     string
+		meta         assetCacheMeta
+		serverStatus int
+		serverBody   string
+		wantRange    string // expected Range header sent to the server, "" if none
+		wantContent  string
+		wantErr      bool
+	}{
+		{
+			name:         "no partial file, plain 200 download",
+			serverStatus: http.StatusOK,
+			serverBody:   "hello world",
+			wantContent:  "hello world",
+		},
+		{
+			name:         "206 appends to the existing partial file",
+			existing:     "hello ",
+			meta:         assetCacheMeta{ETag: `"abc"`},
+			serverStatus: http.StatusPartialContent,
+			serverBody:   "world",
+			wantRange:    "bytes=6-",
+			wantContent:  "hello world",
+		},
+		{
+			name:         "200 in response to a range request restarts from scratch",
+			existing:     "stale partial",
+			meta:         assetCacheMeta{ETag: `"abc"`},
+			serverStatus: http.StatusOK,
+			serverBody:   "full content",
+			wantRange:    "bytes=13-",
+			wantContent:  "full content",
+		},
+		{
+			name:         "416 means the cached file is already complete",
+			existing:     "already complete",
+			meta:         assetCacheMeta{ETag: `"abc"`},
+			serverStatus: http.StatusRequestedRangeNotSatisfiable,
+			wantRange:    "bytes=16-",
+			wantContent:  "already complete",
+		},
+		{
+			name:         "no stored validators means no range is attempted even with a partial file on disk",
+			existing:     "stale partial",
+			serverStatus: http.StatusOK,
+			serverBody:   "full content",
+			wantContent:  "full content",
+		},
+		{
+			name:         "unexpected status is an error",
+			serverStatus: http.StatusInternalServerError,
+			wantErr:      true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dataPath := filepath.Join(dir, "data")
+			metaPath := filepath.Join(dir, "data.json")
+			if tc.existing != "" {
+				if err := os.WriteFile(dataPath, []byte(tc.existing), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.meta.ETag != "" || tc.meta.LastModified != "" {
+				if err := writeAssetCacheMeta(metaPath, tc.meta); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var gotRange string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRange = r.Header.Get("Range")
+				w.Header().Set("ETag", `"new-etag"`)
+				w.WriteHeader(tc.serverStatus)
+				io.WriteString(w, tc.serverBody)
+			}))
+			defer srv.Close()
+
+			err := fetchRangeToCache(context.Background(), srv.URL, dataPath, metaPath)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("fetchRangeToCache: got nil error, want one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetchRangeToCache: unexpected error: %v", err)
+			}
+			if gotRange != tc.wantRange {
+				t.Errorf("Range header sent = %q, want %q", gotRange, tc.wantRange)
+			}
+			got, err := os.ReadFile(dataPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.wantContent {
+				t.Errorf("cached content = %q, want %q", got, tc.wantContent)
+			}
+		})
+	}
+}
+
+func TestFetchToCacheRemovesCacheOnSizeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "too short")
+	}))
+	defer srv.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/releases/assets/1", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, srv.URL, http.StatusFound)
+	})
+	client := newTestClient(t, mux)
+
+	asset := github.ReleaseAsset{ID: github.Int64(1), Name: github.String("asset.bin"), Size: github.Int(1 << 20)}
+	_, err := fetchToCache(context.Background(), client, runArgs{Owner: "o", Repo: "r"}, asset)
+	if err == nil {
+		t.Fatal("fetchToCache: expected a size-mismatch error")
+	}
+
+	cacheDir, err := assetCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataPath, metaPath := assetCachePaths(cacheDir, asset.GetID())
+	if _, err := os.Stat(dataPath); !os.IsNotExist(err) {
+		t.Errorf("fetchToCache: cache data file %s should have been removed after a failed size check", dataPath)
+	}
+	if _, err := os.Stat(metaPath); !os.IsNotExist(err) {
+		t.Errorf("fetchToCache: cache meta file %s should have been removed after a failed size check", metaPath)
+	}
+}
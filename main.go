@@ -1,9 +1,44 @@
-// Command github-release-get downloads single asset from the latest published
-// release of given github repository.
+// Command github-release-get downloads release assets of given github
+// repository.
 //
-// It downloads first asset matching given pattern of the latest published
-// github release to the current directory; it stops if file with such name
-// already exists. For pattern matching see https://golang.org/pkg/path/#Match
+// By default it downloads the assets matching given pattern of the
+// latest published, non-prerelease, non-draft github release to the current
+// directory; it skips files that already exist instead of overwriting them.
+// For pattern matching see https://golang.org/pkg/path/#Match
+//
+// If pattern matches more than one asset, all of them are downloaded, up to
+// -parallel at a time.
+//
+// The -tag flag selects a specific release by its exact tag name instead of
+// the latest one. The -prerelease flag allows the latest release to be a
+// pre-release. The -draft flag fetches a draft release matching -tag; since
+// drafts are only visible to users with push access, it requires
+// GITHUB_TOKEN to be set.
+//
+// The -verify flag, together with -checksum-pattern and/or
+// -signature-pattern, verifies each downloaded asset against a sibling
+// checksums or OpenPGP signature asset from the same release before it is
+// renamed into place.
+//
+// The -self-update flag replaces the currently running binary instead of
+// downloading to the current directory: -pattern is treated as a
+// text/template string with OS, Arch and Ext fields (e.g.
+// "myapp_{{.OS}}_{{.Arch}}{{.Ext}}"), the matching asset is downloaded,
+// transparently unpacked if it is a .tar.gz or .zip archive, and swapped in
+// for the running executable. It refuses to replace a newer version with an
+// older one (as compared by the embedded build version and the release tag,
+// both parsed as semver) unless -force is given.
+//
+// The -json flag prints, for each downloaded asset, a JSON object describing
+// it (tag, release and asset ids, name, size, content type, sha256, download
+// URL, publish date and local path) to stdout, making the tool composable
+// with shell pipelines and CI steps that need to record provenance.
+//
+// Downloads are staged in a resumable cache file under os.UserCacheDir,
+// named after the asset id. If a previous run was interrupted, the next one
+// resumes it with an HTTP Range request validated against the stored
+// ETag/Last-Modified, so the tool tolerates flaky networks and large,
+// multi-gigabyte assets.
 //
 // To access private repositories pass oAuth token via GITHUB_TOKEN environment
 // variable, see https://github.com/settings/tokens page.
@@ -11,13 +46,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"path"
-	"path/filepath"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/artyom/autoflags"
@@ -27,8 +61,9 @@ import (
 
 func main() {
 	args := runArgs{
-		Timeout: time.Minute,
-		Token:   os.Getenv("GITHUB_TOKEN"),
+		Timeout:  time.Minute,
+		Token:    os.Getenv("GITHUB_TOKEN"),
+		Parallel: runtime.GOMAXPROCS(0),
 	}
 	autoflags.Parse(&args)
 	if err := run(context.Background(), args); err != nil {
@@ -42,6 +77,22 @@ type runArgs struct {
 	Repo    string `flag:"repo,repository name"`
 	Pattern string `flag:"pattern,pattern to match release asset name"`
 
+	Parallel int `flag:"parallel,number of assets to download at once"`
+
+	Tag        string `flag:"tag,fetch release with this exact tag instead of the latest one"`
+	Prerelease bool   `flag:"prerelease,consider pre-releases when looking for the latest release"`
+	Draft      bool   `flag:"draft,fetch a draft release matching -tag (requires GITHUB_TOKEN)"`
+
+	Verify           bool   `flag:"verify,verify downloaded asset against a checksums and/or signature asset"`
+	ChecksumPattern  string `flag:"checksum-pattern,pattern matching a checksums asset name, e.g. SHA256SUMS"`
+	SignaturePattern string `flag:"signature-pattern,pattern matching a detached OpenPGP signature asset name"`
+	Pubkey           string `flag:"pubkey,path to armored OpenPGP public key used with -signature-pattern"`
+
+	SelfUpdate bool `flag:"self-update,replace the running binary instead of downloading to a file"`
+	Force      bool `flag:"force,allow -self-update to replace the running binary with an older version"`
+
+	JSON bool `flag:"json,print a JSON object describing each downloaded asset to stdout"`
+
 	Timeout time.Duration `flag:"timeout"`
 
 	Token string // filled in from environment
@@ -51,6 +102,18 @@ func run(ctx context.Context, args runArgs) error {
 	if args.Owner == "" || args.Repo == "" || args.Pattern == "" {
 		return fmt.Errorf("one or more mandatory flags missing")
 	}
+	if args.Draft && args.Tag == "" {
+		return fmt.Errorf("-draft requires -tag to be set")
+	}
+	if args.Draft && args.Token == "" {
+		return fmt.Errorf("-draft requires GITHUB_TOKEN to be set")
+	}
+	if args.Verify && args.ChecksumPattern == "" && args.SignaturePattern == "" {
+		return fmt.Errorf("-verify requires -checksum-pattern and/or -signature-pattern")
+	}
+	if args.Parallel < 1 {
+		args.Parallel = 1
+	}
 	if args.Timeout > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, args.Timeout)
@@ -64,76 +127,118 @@ func run(ctx context.Context, args runArgs) error {
 		client = github.NewClient(oauth2.NewClient(ctx,
 			oauth2.StaticTokenSource(&oauth2.Token{AccessToken: args.Token})))
 	}
-	release, _, err := client.Repositories.GetLatestRelease(ctx, args.Owner, args.Repo)
+	release, err := selectRelease(ctx, client, args)
 	if err != nil {
 		return err
 	}
-	var id int64
-	var name string
-	for _, asset := range release.Assets {
-		name = asset.GetName()
-		ok, err := path.Match(args.Pattern, name)
-		if err != nil {
-			return err
-		}
-		if ok {
-			id = asset.GetID()
-			name = asset.GetName()
-			break
-		}
+	if args.SelfUpdate {
+		return selfUpdate(ctx, client, release, args)
 	}
-	if name == "" {
-		return fmt.Errorf("empty asset name")
-	}
-	dst := filepath.Base(filepath.FromSlash(name))
-	if _, err := os.Stat(dst); !os.IsNotExist(err) {
-		return fmt.Errorf("file %q already exists", dst)
+	assets, err := matchAssetsByPattern(release.Assets, args.Pattern)
+	if err != nil {
+		return err
 	}
-	if id == 0 {
+	if len(assets) == 0 {
 		names := make([]string, 0, len(release.Assets))
 		for _, asset := range release.Assets {
 			names = append(names, asset.GetName())
 		}
 		return fmt.Errorf("no assets matching pattern %q found, assets are: %v", args.Pattern, names)
 	}
-	rc, u, err := client.Repositories.DownloadReleaseAsset(ctx, args.Owner, args.Repo, id)
-	if err != nil {
-		return err
+	return downloadAll(ctx, client, release, args, assets)
+}
+
+// downloadAll downloads assets, up to args.Parallel at a time, returning a
+// combined error for any that failed.
+func downloadAll(ctx context.Context, client *github.Client, release *github.RepositoryRelease, args runArgs, assets []github.ReleaseAsset) error {
+	sem := make(chan struct{}, args.Parallel)
+	errs := make([]error, len(assets))
+	var wg sync.WaitGroup
+	for i, asset := range assets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, asset github.ReleaseAsset) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = downloadAsset(ctx, client, release, args, asset)
+		}(i, asset)
 	}
-	tf, err := ioutil.TempFile("", ".github-release-asset-*")
-	if err != nil {
-		return err
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// matchAssetsByPattern returns all assets whose name matches pattern.
+func matchAssetsByPattern(assets []github.ReleaseAsset, pattern string) ([]github.ReleaseAsset, error) {
+	var matched []github.ReleaseAsset
+	for _, asset := range assets {
+		ok, err := path.Match(pattern, asset.GetName())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, asset)
+		}
 	}
-	defer tf.Close()
-	defer os.Remove(tf.Name())
+	return matched, nil
+}
+
+// selectRelease returns the release args refer to, according to the -tag,
+// -prerelease and -draft flags.
+func selectRelease(ctx context.Context, client *github.Client, args runArgs) (*github.RepositoryRelease, error) {
 	switch {
-	case rc != nil:
-		defer rc.Close()
-		if _, err := io.Copy(tf, rc); err != nil {
-			return err
-		}
-	case u != "":
-		req, err := http.NewRequest(http.MethodGet, u, nil)
+	case args.Draft:
+		return findReleaseByTag(ctx, client, args.Owner, args.Repo, args.Tag, true)
+	case args.Tag != "":
+		release, _, err := client.Repositories.GetReleaseByTag(ctx, args.Owner, args.Repo, args.Tag)
+		return release, err
+	case args.Prerelease:
+		return findLatestRelease(ctx, client, args.Owner, args.Repo)
+	default:
+		release, _, err := client.Repositories.GetLatestRelease(ctx, args.Owner, args.Repo)
+		return release, err
+	}
+}
+
+// findReleaseByTag pages over the repository's releases looking for one
+// matching tag whose draft status equals draft.
+func findReleaseByTag(ctx context.Context, client *github.Client, owner, repo, tag string, draft bool) (*github.RepositoryRelease, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		releases, resp, err := client.Repositories.ListReleases(ctx, owner, repo, opt)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		for _, release := range releases {
+			if release.GetTagName() == tag && release.GetDraft() == draft {
+				return release, nil
+			}
 		}
-		req = req.WithContext(ctx)
-		r, err := http.DefaultClient.Do(req)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return nil, fmt.Errorf("no release with tag %q found", tag)
+}
+
+// findLatestRelease returns the newest published release, pre-release or
+// not, skipping drafts.
+func findLatestRelease(ctx context.Context, client *github.Client, owner, repo string) (*github.RepositoryRelease, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		releases, resp, err := client.Repositories.ListReleases(ctx, owner, repo, opt)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		defer r.Body.Close()
-		if r.StatusCode != http.StatusOK {
-			return fmt.Errorf("invalid status: %s", r.Status)
+		for _, release := range releases {
+			if !release.GetDraft() {
+				return release, nil
+			}
 		}
-		if _, err := io.Copy(tf, r.Body); err != nil {
-			return err
+		if resp.NextPage == 0 {
+			break
 		}
-	default:
-		return fmt.Errorf("cannot download asset release, don't have sensible link for that")
-	}
-	if err := tf.Close(); err != nil {
-		return err
+		opt.Page = resp.NextPage
 	}
-	return os.Rename(tf.Name(), dst)
+	return nil, fmt.Errorf("no published releases found")
 }
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v25/github"
+)
+
+// newTestClient returns a github.Client whose API calls are routed to mux.
+func newTestClient(t *testing.T, mux *http.ServeMux) *github.Client {
+	t.Helper()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	client := github.NewClient(nil)
+	u, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = u
+	return client
+}
+
+func TestFindReleaseByTag(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/releases", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "", "1":
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=2>; rel="next"`, r.URL.Path))
+			fmt.Fprint(w, `[{"id":1,"tag_name":"v1.0.0","draft":false}]`)
+		case "2":
+			fmt.Fprint(w, `[{"id":2,"tag_name":"v2.0.0","draft":true},{"id":3,"tag_name":"v2.0.0","draft":false}]`)
+		}
+	})
+	client := newTestClient(t, mux)
+
+	got, err := findReleaseByTag(context.Background(), client, "o", "r", "v2.0.0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetID() != 2 {
+		t.Errorf("findReleaseByTag(draft=true) = id %d, want 2", got.GetID())
+	}
+
+	got, err = findReleaseByTag(context.Background(), client, "o", "r", "v2.0.0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetID() != 3 {
+		t.Errorf("findReleaseByTag(draft=false) = id %d, want 3", got.GetID())
+	}
+
+	if _, err := findReleaseByTag(context.Background(), client, "o", "r", "v9.9.9", false); err == nil {
+		t.Fatal("findReleaseByTag: expected an error for a tag that doesn't exist")
+	}
+}
+
+func TestFindLatestRelease(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/releases", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "", "1":
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=2>; rel="next"`, r.URL.Path))
+			fmt.Fprint(w, `[{"id":1,"draft":true}]`)
+		case "2":
+			fmt.Fprint(w, `[{"id":2,"draft":false},{"id":3,"draft":false}]`)
+		}
+	})
+	client := newTestClient(t, mux)
+
+	got, err := findLatestRelease(context.Background(), client, "o", "r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetID() != 2 {
+		t.Errorf("findLatestRelease = id %d, want 2 (first non-draft, across pages)", got.GetID())
+	}
+}
+
+func TestFindLatestReleaseAllDrafts(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/releases", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":1,"draft":true}]`)
+	})
+	client := newTestClient(t, mux)
+
+	if _, err := findLatestRelease(context.Background(), client, "o", "r"); err == nil {
+		t.Fatal("findLatestRelease: expected an error when every release is a draft")
+	}
+}
+
+func TestSelectRelease(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1,"tag_name":"latest"}`)
+	})
+	mux.HandleFunc("/repos/o/r/releases/tags/v1.2.3", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":2,"tag_name":"v1.2.3"}`)
+	})
+	mux.HandleFunc("/repos/o/r/releases", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":3,"tag_name":"v2.0.0","draft":false,"prerelease":true},{"id":4,"tag_name":"v1.2.3","draft":true}]`)
+	})
+	client := newTestClient(t, mux)
+
+	cases := []struct {
+		name string
+		args runArgs
+		want int64
+	}{
+		{name: "default uses the latest endpoint", args: runArgs{Owner: "o", Repo: "r"}, want: 1},
+		{name: "-tag uses the by-tag endpoint", args: runArgs{Owner: "o", Repo: "r", Tag: "v1.2.3"}, want: 2},
+		{name: "-prerelease lists and takes the first non-draft", args: runArgs{Owner: "o", Repo: "r", Prerelease: true}, want: 3},
+		{name: "-draft lists and matches tag+draft", args: runArgs{Owner: "o", Repo: "r", Tag: "v1.2.3", Draft: true}, want: 4},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := selectRelease(context.Background(), client, tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.GetID() != tc.want {
+				t.Errorf("selectRelease(%+v) = id %d, want %d", tc.args, got.GetID(), tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchAssetsByPattern(t *testing.T) {
+	assets := []github.ReleaseAsset{
+		{Name: github.String("app_linux_amd64.tar.gz")},
+		{Name: github.String("app_darwin_amd64.tar.gz")},
+		{Name: github.String("app_windows_amd64.zip")},
+		{Name: github.String("SHA256SUMS")},
+	}
+	got, err := matchAssetsByPattern(assets, "app_*_amd64.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("matchAssetsByPattern: got %d assets, want 2", len(got))
+	}
+	for _, a := range got {
+		if !strings.HasSuffix(a.GetName(), "_amd64.tar.gz") {
+			t.Errorf("matchAssetsByPattern: unexpected match %q", a.GetName())
+		}
+	}
+
+	if _, err := matchAssetsByPattern(assets, "["); err == nil {
+		t.Fatal("matchAssetsByPattern: expected an error for a malformed pattern")
+	}
+
+	none, err := matchAssetsByPattern(assets, "nothing-matches-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(none) != 0 {
+		t.Errorf("matchAssetsByPattern: got %d assets, want 0", len(none))
+	}
+}
+
+func TestDownloadAll(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/releases/assets/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	mux.HandleFunc("/repos/o/r/releases/assets/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	mux.HandleFunc("/repos/o/r/releases/assets/3", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	client := newTestClient(t, mux)
+
+	assets := []github.ReleaseAsset{
+		{ID: github.Int64(1), Name: github.String("good1.bin")},
+		{ID: github.Int64(2), Name: github.String("good2.bin")},
+		{ID: github.Int64(3), Name: github.String("bad.bin")},
+	}
+	args := runArgs{Owner: "o", Repo: "r", Parallel: 2}
+	err = downloadAll(context.Background(), client, &github.RepositoryRelease{}, args, assets)
+	if err == nil {
+		t.Fatal("downloadAll: expected a combined error for the failing asset")
+	}
+	if !strings.Contains(err.Error(), "bad.bin") {
+		t.Errorf("downloadAll: error %q doesn't mention the failing asset", err)
+	}
+	for _, name := range []string{"good1.bin", "good2.bin"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("downloadAll: expected %s to be downloaded: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bad.bin")); !os.IsNotExist(err) {
+		t.Errorf("downloadAll: bad.bin should not have been written")
+	}
+}
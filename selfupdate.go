@@ -0,0 +1,268 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v25/github"
+	"golang.org/x/mod/semver"
+)
+
+// selfVersion holds this binary's current version. It is normally set at
+// build time via -ldflags "-X main.selfVersion=v1.2.3" and is used by
+// selfUpdate to refuse downgrades unless -force is given. It is left empty
+// by default, in which case the downgrade check is skipped.
+var selfVersion string
+
+// selfUpdate replaces the currently running executable with the asset from
+// release matching args.Pattern, rendered as a text/template with the
+// current OS, Arch and Ext.
+func selfUpdate(ctx context.Context, client *github.Client, release *github.RepositoryRelease, args runArgs) error {
+	if !args.Force {
+		if err := checkNotDowngrade(release.GetTagName()); err != nil {
+			return err
+		}
+	}
+	name, err := renderAssetPattern(args.Pattern)
+	if err != nil {
+		return err
+	}
+	asset, err := matchAssetByPattern(release.Assets, name)
+	if err != nil {
+		return err
+	}
+	data, err := downloadAssetBytes(ctx, client, args.Owner, args.Repo, asset.GetID())
+	if err != nil {
+		return err
+	}
+	tf, err := ioutil.TempFile("", ".github-release-asset-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tf.Name())
+	if _, err := tf.Write(data); err != nil {
+		tf.Close()
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		return err
+	}
+	if args.Verify {
+		sum := sha256.Sum256(data)
+		if err := verifyAsset(ctx, client, release, args, asset.GetName(), sum[:], tf.Name()); err != nil {
+			return err
+		}
+	}
+	exe, err := extractExecutable(tf.Name(), asset.GetName())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(exe)
+	return replaceExecutable(exe)
+}
+
+// renderAssetPattern renders pattern as a text/template with fields OS,
+// Arch (runtime.GOOS, runtime.GOARCH) and Ext (".exe" on windows, empty
+// otherwise).
+func renderAssetPattern(pattern string) (string, error) {
+	tmpl, err := template.New("pattern").Parse(pattern)
+	if err != nil {
+		return "", err
+	}
+	ext := ""
+	if runtime.GOOS == "windows" {
+		ext = ".exe"
+	}
+	data := struct{ OS, Arch, Ext string }{runtime.GOOS, runtime.GOARCH, ext}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// checkNotDowngrade returns an error if tag, parsed as semver, is older than
+// selfVersion. Comparison is skipped if either version isn't valid semver,
+// or if selfVersion wasn't set at build time.
+func checkNotDowngrade(tag string) error {
+	if selfVersion == "" {
+		return nil
+	}
+	cur, want := addVPrefix(selfVersion), addVPrefix(tag)
+	if !semver.IsValid(cur) || !semver.IsValid(want) {
+		return nil
+	}
+	if semver.Compare(want, cur) < 0 {
+		return fmt.Errorf("refusing to downgrade from %s to %s, pass -force to override", selfVersion, tag)
+	}
+	return nil
+}
+
+func addVPrefix(s string) string {
+	if strings.HasPrefix(s, "v") {
+		return s
+	}
+	return "v" + s
+}
+
+// extractExecutable returns the path to the executable contained in path,
+// unpacking it first if assetName indicates a .tar.gz/.tgz or .zip archive.
+// The returned path may be path itself; the caller is responsible for
+// removing it once done.
+func extractExecutable(path, assetName string) (string, error) {
+	switch {
+	case strings.HasSuffix(assetName, ".tar.gz"), strings.HasSuffix(assetName, ".tgz"):
+		return extractFromTarGz(path)
+	case strings.HasSuffix(assetName, ".zip"):
+		return extractFromZip(path)
+	default:
+		return path, nil
+	}
+}
+
+// extractFromTarGz picks the largest regular file in the gzipped tar archive
+// at path, writes it to a new temporary file and returns its path.
+func extractFromTarGz(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer gz.Close()
+	var bestPath string
+	var bestSize int64
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			os.Remove(bestPath)
+			return "", err
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Size <= bestSize {
+			continue
+		}
+		out, err := ioutil.TempFile("", ".github-release-exe-*")
+		if err != nil {
+			os.Remove(bestPath)
+			return "", err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			os.Remove(out.Name())
+			os.Remove(bestPath)
+			return "", err
+		}
+		if err := out.Close(); err != nil {
+			os.Remove(out.Name())
+			os.Remove(bestPath)
+			return "", err
+		}
+		os.Remove(bestPath)
+		bestPath, bestSize = out.Name(), hdr.Size
+	}
+	if bestPath == "" {
+		return "", fmt.Errorf("no regular file found in archive")
+	}
+	return bestPath, nil
+}
+
+// extractFromZip picks the largest regular file in the zip archive at path,
+// writes it to a new temporary file and returns its path.
+func extractFromZip(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return "", err
+	}
+	var bestPath string
+	var bestSize uint64
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() || zf.UncompressedSize64 <= bestSize {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			os.Remove(bestPath)
+			return "", err
+		}
+		out, err := ioutil.TempFile("", ".github-release-exe-*")
+		if err != nil {
+			rc.Close()
+			os.Remove(bestPath)
+			return "", err
+		}
+		_, err = io.Copy(out, rc)
+		rc.Close()
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+			os.Remove(bestPath)
+			return "", err
+		}
+		if err := out.Close(); err != nil {
+			os.Remove(out.Name())
+			os.Remove(bestPath)
+			return "", err
+		}
+		os.Remove(bestPath)
+		bestPath, bestSize = out.Name(), zf.UncompressedSize64
+	}
+	if bestPath == "" {
+		return "", fmt.Errorf("no regular file found in archive")
+	}
+	return bestPath, nil
+}
+
+// replaceExecutable atomically swaps the running executable for the file at
+// newPath, using a rename-then-remove-old dance so it also works on Windows,
+// where an executable cannot be overwritten or removed while running.
+func replaceExecutable(newPath string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if self, err = filepath.EvalSymlinks(self); err != nil {
+		return err
+	}
+	if err := os.Chmod(newPath, 0755); err != nil {
+		return err
+	}
+	old := self + ".old"
+	os.Remove(old) // best effort, leftover from a previous update
+	if err := os.Rename(self, old); err != nil {
+		return err
+	}
+	if err := os.Rename(newPath, self); err != nil {
+		os.Rename(old, self) // best effort restore
+		return err
+	}
+	os.Remove(old) // best effort; may still be locked by the old running process on windows
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestCheckNotDowngrade(t *testing.T) {
+	cases := []struct {
+		name    string
+		cur     string
+		tag     string
+		wantErr bool
+	}{
+		{name: "newer tag is fine", cur: "v1.2.0", tag: "v1.3.0"},
+		{name: "same tag is fine", cur: "v1.2.0", tag: "v1.2.0"},
+		{name: "older tag is a downgrade", cur: "v1.2.0", tag: "v1.1.0", wantErr: true},
+		{name: "missing v prefix is tolerated", cur: "1.2.0", tag: "1.1.0", wantErr: true},
+		{name: "empty selfVersion skips the check", cur: "", tag: "v0.0.1"},
+		{name: "non-semver tag skips the check", cur: "v1.2.0", tag: "latest"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			old := selfVersion
+			selfVersion = tc.cur
+			defer func() { selfVersion = old }()
+
+			err := checkNotDowngrade(tc.tag)
+			if tc.wantErr && err == nil {
+				t.Fatalf("checkNotDowngrade(%q) with selfVersion=%q: expected an error", tc.tag, tc.cur)
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("checkNotDowngrade(%q) with selfVersion=%q: unexpected error: %v", tc.tag, tc.cur, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/v25/github"
+	"golang.org/x/crypto/openpgp"
+)
+
+// embeddedPubKey optionally holds an armored OpenPGP public key baked in at
+// build time, e.g. via -ldflags "-X main.embeddedPubKey=...". It is used by
+// verifyAsset as a fallback when -pubkey is not given.
+var embeddedPubKey string
+
+// verifyAsset checks the asset named name, whose downloaded content sha256
+// sum is sum and whose content is stored at tempFilePath, against the
+// checksums and/or signature sibling assets configured by args, looking them
+// up among release's assets.
+func verifyAsset(ctx context.Context, client *github.Client, release *github.RepositoryRelease, args runArgs, name string, sum []byte, tempFilePath string) error {
+	if args.ChecksumPattern != "" {
+		asset, err := matchAssetByPattern(release.Assets, args.ChecksumPattern)
+		if err != nil {
+			return err
+		}
+		data, err := downloadAssetBytes(ctx, client, args.Owner, args.Repo, asset.GetID())
+		if err != nil {
+			return err
+		}
+		want, err := checksumForName(data, name)
+		if err != nil {
+			return err
+		}
+		if got := hex.EncodeToString(sum); !strings.EqualFold(want, got) {
+			return fmt.Errorf("checksum mismatch for %q: want %s, got %s", name, want, got)
+		}
+	}
+	if args.SignaturePattern != "" {
+		asset, err := matchAssetByPattern(release.Assets, args.SignaturePattern)
+		if err != nil {
+			return err
+		}
+		sig, err := downloadAssetBytes(ctx, client, args.Owner, args.Repo, asset.GetID())
+		if err != nil {
+			return err
+		}
+		if err := verifyDetachedSignature(tempFilePath, sig, args.Pubkey); err != nil {
+			return fmt.Errorf("signature verification failed for %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// matchAssetByPattern returns the first asset whose name matches pattern.
+func matchAssetByPattern(assets []github.ReleaseAsset, pattern string) (github.ReleaseAsset, error) {
+	for _, asset := range assets {
+		ok, err := path.Match(pattern, asset.GetName())
+		if err != nil {
+			return github.ReleaseAsset{}, err
+		}
+		if ok {
+			return asset, nil
+		}
+	}
+	return github.ReleaseAsset{}, fmt.Errorf("no asset matching pattern %q found", pattern)
+}
+
+// checksumForName scans data, formatted as lines of "<hex>  <name>" like
+// those produced by sha256sum, and returns the hex digest for the line whose
+// name matches name.
+func checksumForName(data []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		entry := strings.TrimPrefix(fields[1], "*")
+		if entry == name || filepath.Base(entry) == name {
+			return fields[0], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no checksum entry for %q found", name)
+}
+
+// verifyDetachedSignature checks the OpenPGP detached signature sig against
+// the content of the file at path, using the public key from pubkeyPath, or
+// embeddedPubKey if pubkeyPath is empty.
+func verifyDetachedSignature(path string, sig []byte, pubkeyPath string) error {
+	keyRing, err := loadPubKeyRing(pubkeyPath)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = openpgp.CheckDetachedSignature(keyRing, f, bytes.NewReader(sig))
+	return err
+}
+
+func loadPubKeyRing(pubkeyPath string) (openpgp.EntityList, error) {
+	if pubkeyPath == "" {
+		if embeddedPubKey == "" {
+			return nil, fmt.Errorf("no public key available: pass -pubkey or build with an embedded key")
+		}
+		return openpgp.ReadArmoredKeyRing(strings.NewReader(embeddedPubKey))
+	}
+	f, err := os.Open(pubkeyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return openpgp.ReadArmoredKeyRing(f)
+}
+
+// downloadAssetBytes fetches the full content of the release asset id.
+func downloadAssetBytes(ctx context.Context, client *github.Client, owner, repo string, id int64) ([]byte, error) {
+	rc, u, err := client.Repositories.DownloadReleaseAsset(ctx, owner, repo, id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case rc != nil:
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	case u != "":
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("invalid status: %s", r.Status)
+		}
+		return ioutil.ReadAll(r.Body)
+	default:
+		return nil, fmt.Errorf("cannot download asset, don't have sensible link for that")
+	}
+}
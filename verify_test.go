@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestChecksumForName(t *testing.T) {
+	const data = `d41d8cd98f00b204e9800998ecf8427e  empty.txt
+da39a3ee5e6b4b0d3255bfef95601890afd80709 *binary.bin
+2e7d2c03a9507ae265ecf5b5356885a53393a2029582a0db41791a8ab0b3b3e  dist/release.tar.gz
+`
+	cases := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty.txt", want: "d41d8cd98f00b204e9800998ecf8427e"},
+		{name: "binary.bin", want: "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+		{name: "release.tar.gz", want: "2e7d2c03a9507ae265ecf5b5356885a53393a2029582a0db41791a8ab0b3b3e"},
+		{name: "missing.txt", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := checksumForName([]byte(data), tc.name)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("checksumForName(%q): expected an error, got %q", tc.name, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checksumForName(%q): unexpected error: %v", tc.name, err)
+			}
+			if got != tc.want {
+				t.Errorf("checksumForName(%q) = %q, want %q", tc.name, got, tc.want)
+			}
+		})
+	}
+}